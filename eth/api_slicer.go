@@ -2,14 +2,48 @@ package eth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
+// Sentinel kinds of RootResolutionError, distinguishing why a stateRoot
+// could not be safely resolved before opening a trie for it.
+var (
+	ErrRootPruned       = errors.New("state root has been pruned")
+	ErrRootNonCanonical = errors.New("state root is not on the canonical chain")
+	ErrRootUnknown      = errors.New("state root is unknown")
+)
+
+// RootResolutionError is returned instead of an opaque "error loading the
+// trie" whenever a requested stateRoot cannot be safely resolved from local
+// state. ClosestRoot, when set, is the nearest canonical root tooling can
+// retry against, e.g. on an archive peer.
+type RootResolutionError struct {
+	Kind        error
+	ClosestRoot common.Hash
+}
+
+func (e *RootResolutionError) Error() string {
+	if e.ClosestRoot == (common.Hash{}) {
+		return e.Kind.Error()
+	}
+	return fmt.Sprintf("%s (closest available canonical root: %s)", e.Kind.Error(), e.ClosestRoot.Hex())
+}
+
+func (e *RootResolutionError) Unwrap() error { return e.Kind }
+
 // GetSlice response structures
 
 type GetSliceKeysResponse struct {
@@ -20,7 +54,59 @@ type GetSliceKeysResponse struct {
 }
 
 type GetSliceKeysResponseMetrics struct {
-	Time map[string]string `json:"time (ms)"` // stem, state, storage (one by one)
+	Time   map[string]string `json:"time (ms)"` // stem, state, storage (one by one)
+	Counts map[string]int    `json:"counts,omitempty"`
+	Source string            `json:"source,omitempty"` // "trie" (default) or "snapshot"
+}
+
+// GetSlice response structures
+//
+// Unlike GetSliceKeys, which only reports the hex-encoded keys touched by a
+// slice traversal, GetSlice resolves every one of those keys to its raw,
+// RLP-encoded trie node so that a caller can reconstruct the sub-trie
+// offline without a follow-up GetLevelDbKey round-trip per node.
+
+type GetSliceResponse struct {
+	SliceID             string                       `json:"slice-id"`
+	TrieNodes           TrieNodes                    `json:"trieNodes"`
+	Leaves              map[string]LeafData          `json:"leaves"`
+	ExtraContractLeaves map[string]ExtraContractLeaf `json:"extraContractLeaves"`
+	Metrics             GetSliceResponseMetrics      `json:"metrics"`
+}
+
+// ExtraContractLeaf carries the metadata a downstream indexer needs to
+// decide whether to recursively request the storage slice of a contract
+// account uncovered while slicing the state trie. EOAs (empty code hash and
+// empty storage root) are never included.
+type ExtraContractLeaf struct {
+	AddressHash string `json:"addressHash"`
+	StorageRoot string `json:"storageRoot"`
+	CodeHash    string `json:"codeHash"`
+	CodeSize    int    `json:"codeSize"`
+}
+
+// TrieNodes groups the raw node blobs uncovered by a slice traversal by the
+// phase of the traversal that uncovered them, keyed by node hash.
+type TrieNodes struct {
+	Stem  map[string]string `json:"stem"`  // nodes on the path from the state root down to the slice
+	Head  map[string]string `json:"head"`  // the node the slice starts at
+	Slice map[string]string `json:"slice"` // every node found below the head, down to the requested depth
+}
+
+// LeafData is a decoded account or storage leaf uncovered while walking a
+// slice. Account leaves populate Nonce/Balance/Root/CodeHash; storage leaves
+// only populate Value.
+type LeafData struct {
+	Nonce    uint64 `json:"nonce,omitempty"`
+	Balance  string `json:"balance,omitempty"`
+	Root     string `json:"root,omitempty"`
+	CodeHash string `json:"codeHash,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+type GetSliceResponseMetrics struct {
+	Counts map[string]int    `json:"counts"`
+	Time   map[string]string `json:"time (ms)"`
 }
 
 // GetSliceKeys retrieves a slice from the state, alongside its stem.
@@ -45,6 +131,12 @@ func (api *PublicDebugAPI) GetSliceKeys(ctx context.Context, path string, depth
 		return GetSliceKeysResponse{},
 			fmt.Errorf("incorrect input, expected string representation of hex for path")
 	}
+	// a path longer than a full 32-byte hash can never be a valid prefix, and
+	// the snapshot fallback below needs to pad it out to 64 hex chars
+	if len(path) > 64 {
+		return GetSliceKeysResponse{},
+			fmt.Errorf("incorrect input, path must be at most 64 hex characters")
+	}
 
 	// prepare the response object
 	response := GetSliceKeysResponse{
@@ -56,12 +148,28 @@ func (api *PublicDebugAPI) GetSliceKeys(ctx context.Context, path string, depth
 		},
 	}
 
+	root := common.BytesToHash(stateRootByte)
+
+	// make sure root is actually safe to load before we try: it must
+	// either still be within the canonical TriesInMemory window, or be
+	// serviceable from the snapshot layer if the MPT itself was pruned
+	timerStart = time.Now().UnixNano()
+	useSnapshot, err := api.resolveStateRoot(root)
+	if err != nil {
+		return GetSliceKeysResponse{}, err
+	}
+	if useSnapshot {
+		response.Metrics.Source = "snapshot"
+		return api.getSliceKeysFromSnapshot(response, root, path, slicePath, depth)
+	}
+	response.Metrics.Source = "trie"
+
 	// load a trie with the given state root from the cache (ideally)
 	// TODO
 	// we want to have the best mechanism to either fetch the trie
 	// from the cache geth is using, or well load it and cache it.
 	timerStart = time.Now().UnixNano()
-	tr, err := api.eth.BlockChain().GetSecureTrie(common.BytesToHash(stateRootByte))
+	tr, err := api.eth.BlockChain().GetSecureTrie(root)
 	if err != nil {
 		return GetSliceKeysResponse{}, fmt.Errorf("error loading the trie %v", err)
 	}
@@ -103,13 +211,630 @@ func (api *PublicDebugAPI) GetSliceKeys(ctx context.Context, path string, depth
 		response.State = append(response.State, keys)
 	}
 
-	// fetch the smart contract storage
-	// TODO
+	// smart contract storage is sliced separately, see GetStorageSliceKeys
 
 	// we are done here
 	return response, nil
 }
 
+// GetStorageSliceKeys retrieves a slice from a contract's storage trie,
+// alongside its stem, mirroring GetSliceKeys but operating on the storage
+// trie of contractAddress as it stood at stateRoot instead of the state
+// trie itself.
+//
+// Parameters
+// - path 				path from root where the slice starts
+// - depth				depth to walk from the slice head
+// - stateRoot			state root to resolve contractAddress's storage trie at
+// - contractAddress	address of the contract whose storage trie is sliced
+func (api *PublicDebugAPI) GetStorageSliceKeys(ctx context.Context, path string, depth int, stateRoot string, contractAddress common.Address) (GetSliceKeysResponse, error) {
+	var timerStart int64
+
+	// check the given root
+	stateRootByte, err := hexutil.Decode(stateRoot)
+	if err != nil {
+		return GetSliceKeysResponse{},
+			fmt.Errorf("incorrect input, expected string representation of hex for root")
+	}
+
+	// check the given path
+	slicePath := pathStringToKeyBytes(path)
+	if slicePath == nil {
+		return GetSliceKeysResponse{},
+			fmt.Errorf("incorrect input, expected string representation of hex for path")
+	}
+
+	// prepare the response object
+	response := GetSliceKeysResponse{
+		SliceID: fmt.Sprintf("%s-%02d-%s-storage", path, depth, stateRoot[2:8]),
+		Stem:    make([]string, 0),
+		State:   make([][]string, 0),
+		Metrics: GetSliceKeysResponseMetrics{
+			Time:   make(map[string]string),
+			Counts: make(map[string]int),
+		},
+	}
+
+	// load the state at stateRoot, then open the contract's storage trie
+	timerStart = time.Now().UnixNano()
+	statedb, err := api.eth.BlockChain().StateAt(common.BytesToHash(stateRootByte))
+	if err != nil {
+		return GetSliceKeysResponse{}, fmt.Errorf("error loading the state %v", err)
+	}
+	storageTrie, err := statedb.StorageTrie(contractAddress)
+	if err != nil {
+		return GetSliceKeysResponse{}, fmt.Errorf("error loading the storage trie %v", err)
+	}
+	if storageTrie == nil {
+		return GetSliceKeysResponse{}, fmt.Errorf("no storage trie for contract %s at root %s", contractAddress.Hex(), stateRoot)
+	}
+	// StorageTrie returns the generic state.Trie interface; cachingDB.OpenStorageTrie
+	// (the only implementation StateDB.StorageTrie goes through) always
+	// constructs a *trie.SecureTrie under that interface, but assert rather
+	// than assume it in case a future state.Database implementation changes
+	// that, and see TestStorageTrieIsSecureTrie for a test exercising the
+	// assumption against the real state package
+	tr, ok := storageTrie.(*trie.SecureTrie)
+	if !ok {
+		return GetSliceKeysResponse{}, fmt.Errorf("storage trie for contract %s is not slice-iterable (got %T)", contractAddress.Hex(), storageTrie)
+	}
+	response.Metrics.Time["00 trie-loading"] = timeDiffToMiliseconds(time.Now().UnixNano() - timerStart)
+
+	// fetch the stem
+	timerStart = time.Now().UnixNano()
+	it := tr.NewSliceIterator(slicePath)
+	it.Next(true)
+	stemKeys := it.StemKeys()
+	response.Metrics.Time["01 fetch-stem-keys"] = timeDiffToMiliseconds(time.Now().UnixNano() - timerStart)
+	response.Metrics.Counts["04 stem-storage-nodes"] = len(stemKeys)
+	var keyStr string
+	for _, key := range stemKeys {
+		keyStr = fmt.Sprintf("%x", key)
+		response.Stem = append(response.Stem, keyStr)
+	}
+
+	// fetch the slice
+	timerStart = time.Now().UnixNano()
+	it = tr.NewSliceIterator(slicePath)
+	stateKeys, leaves := it.Slice(depth, false)
+	response.Metrics.Time["02 fetch-slice-keys"] = timeDiffToMiliseconds(time.Now().UnixNano() - timerStart)
+	var keys []string
+	for _, depthLevel := range stateKeys {
+		// remember that we make a separate golang slice per depth level
+		if len(depthLevel) == 0 {
+			break
+		}
+
+		keys = make([]string, 0)
+		for _, key := range depthLevel {
+			keyStr = fmt.Sprintf("%x", key)
+			keys = append(keys, keyStr)
+		}
+		response.State = append(response.State, keys)
+	}
+	response.Metrics.Counts["05 leaves-fetched"] = len(leaves)
+
+	// we are done here
+	return response, nil
+}
+
+// GetSlice retrieves a slice from the state, alongside its stem, resolving
+// every key touched along the way to its raw trie node so that the sub-trie
+// can be reconstructed offline without further RPCs.
+//
+// Parameters
+// - path 		path from root where the slice starts
+// - depth		depth to walk from the slice head
+// - stateRoot	state root of the GetSliceResponse
+func (api *PublicDebugAPI) GetSlice(ctx context.Context, path string, depth int, stateRoot string) (GetSliceResponse, error) {
+	var timerStart int64
+
+	// check the given root
+	stateRootByte, err := hexutil.Decode(stateRoot)
+	if err != nil {
+		return GetSliceResponse{},
+			fmt.Errorf("incorrect input, expected string representation of hex for root")
+	}
+
+	// check the given path
+	slicePath := pathStringToKeyBytes(path)
+	if slicePath == nil {
+		return GetSliceResponse{},
+			fmt.Errorf("incorrect input, expected string representation of hex for path")
+	}
+
+	// prepare the response object
+	response := GetSliceResponse{
+		SliceID: fmt.Sprintf("%s-%02d-%s", path, depth, stateRoot[2:8]),
+		TrieNodes: TrieNodes{
+			Stem:  make(map[string]string),
+			Head:  make(map[string]string),
+			Slice: make(map[string]string),
+		},
+		Leaves:              make(map[string]LeafData),
+		ExtraContractLeaves: make(map[string]ExtraContractLeaf),
+		Metrics: GetSliceResponseMetrics{
+			Counts: make(map[string]int),
+			Time:   make(map[string]string),
+		},
+	}
+
+	// make sure root is actually safe to load before we try, exactly like
+	// GetSliceKeys does; GetSlice has no snapshot-backed equivalent (the
+	// snapshot layer has no trie nodes to resolve), so a pruned/non-canonical
+	// root is always an error here
+	root := common.BytesToHash(stateRootByte)
+	timerStart = time.Now().UnixNano()
+	useSnapshot, err := api.resolveStateRoot(root)
+	if err != nil {
+		return GetSliceResponse{}, err
+	}
+	if useSnapshot {
+		return GetSliceResponse{}, fmt.Errorf("state root %s has no trie left to read nodes from; it is only servable from the snapshot layer, which has no trie nodes (try GetSliceKeys instead)", root.Hex())
+	}
+
+	// load a trie with the given state root from the cache (ideally)
+	tr, err := api.eth.BlockChain().GetSecureTrie(root)
+	if err != nil {
+		return GetSliceResponse{}, fmt.Errorf("error loading the trie %v", err)
+	}
+	response.Metrics.Time["00 trie-loading"] = timeDiffToMiliseconds(time.Now().UnixNano() - timerStart)
+
+	// fetch the stem, resolving every node hash to its blob along the way
+	timerStart = time.Now().UnixNano()
+	it := tr.NewSliceIterator(slicePath)
+	it.Next(true)
+	stemKeys := it.StemKeys()
+	for _, key := range stemKeys {
+		if blob, _, ok := api.resolveTrieNode(key); ok {
+			response.TrieNodes.Stem[fmt.Sprintf("%x", key)] = blob
+		}
+	}
+	response.Metrics.Counts["00 stem-nodes"] = len(response.TrieNodes.Stem)
+	response.Metrics.Time["01 fetch-stem-keys"] = timeDiffToMiliseconds(time.Now().UnixNano() - timerStart)
+
+	// the head is the last node on the stem walk: the node the iterator
+	// lands on once it has walked down to the requested path
+	if len(stemKeys) > 0 {
+		head := stemKeys[len(stemKeys)-1]
+		if blob, _, ok := api.resolveTrieNode(head); ok {
+			response.TrieNodes.Head[fmt.Sprintf("%x", head)] = blob
+		}
+	}
+
+	// fetch the slice itself, resolving every node and collecting the
+	// leaves uncovered along the way
+	timerStart = time.Now().UnixNano()
+	it = tr.NewSliceIterator(slicePath)
+	stateKeys, leaves := it.Slice(depth, false)
+	maxDepth := 0
+	for d, depthLevel := range stateKeys {
+		// remember that we make a separate golang slice per depth level
+		if len(depthLevel) == 0 {
+			break
+		}
+
+		maxDepth = d + 1
+		for _, key := range depthLevel {
+			if blob, _, ok := api.resolveTrieNode(key); ok {
+				response.TrieNodes.Slice[fmt.Sprintf("%x", key)] = blob
+			}
+		}
+	}
+	response.Metrics.Counts["01 max-depth"] = maxDepth
+	response.Metrics.Counts["02 total-trie-nodes"] = len(response.TrieNodes.Stem) + len(response.TrieNodes.Head) + len(response.TrieNodes.Slice)
+	response.Metrics.Time["02 fetch-slice-keys"] = timeDiffToMiliseconds(time.Now().UnixNano() - timerStart)
+
+	// decode every account leaf uncovered while walking the slice
+	timerStart = time.Now().UnixNano()
+	for _, leaf := range leaves {
+		var account types.StateAccount
+		if err := rlp.DecodeBytes(leaf.Value, &account); err != nil {
+			continue
+		}
+		leafKey := fmt.Sprintf("%x", leaf.Key)
+		response.Leaves[leafKey] = LeafData{
+			Nonce:    account.Nonce,
+			Balance:  account.Balance.String(),
+			Root:     account.Root.Hex(),
+			CodeHash: hexutil.Encode(account.CodeHash),
+		}
+
+		// a non-empty code hash or storage root means this is a contract
+		// account; EOAs are filtered out so we don't bloat the response
+		codeHash := common.BytesToHash(account.CodeHash)
+		if !isEOAAccount(codeHash, account.Root) {
+			code := rawdb.ReadCode(api.eth.ChainDb(), codeHash)
+			response.ExtraContractLeaves[leafKey] = ExtraContractLeaf{
+				AddressHash: leafKey,
+				StorageRoot: account.Root.Hex(),
+				CodeHash:    hexutil.Encode(account.CodeHash),
+				CodeSize:    len(code),
+			}
+		}
+	}
+	response.Metrics.Counts["03 leaves"] = len(response.Leaves)
+	response.Metrics.Counts["05 leaves-fetched"] = len(leaves)
+	response.Metrics.Time["03 decode-leaves"] = timeDiffToMiliseconds(time.Now().UnixNano() - timerStart)
+
+	return response, nil
+}
+
+// SliceSubscriptionOptions controls how much data SubscribeSlice includes in
+// each per-depth notification.
+type SliceSubscriptionOptions struct {
+	IncludeNodes  bool `json:"includeNodes"`
+	IncludeLeaves bool `json:"includeLeaves"`
+}
+
+// SliceNotification is one message emitted by a SubscribeSlice
+// subscription: the stem keys (Depth -1, sent first), the keys of a single
+// depth level, each with node blobs if requested, or the terminal message
+// carrying the decoded leaves (if requested) and the aggregated metrics once
+// the traversal is complete.
+type SliceNotification struct {
+	SliceID string                   `json:"slice-id"`
+	Depth   int                      `json:"depth"`
+	Keys    []string                 `json:"keys,omitempty"`
+	Nodes   map[string]string        `json:"nodes,omitempty"`
+	Leaves  map[string]LeafData      `json:"leaves,omitempty"`
+	Done    bool                     `json:"done"`
+	Metrics *GetSliceResponseMetrics `json:"metrics,omitempty"`
+}
+
+// SubscribeSlice is the streaming counterpart to GetSlice: instead of
+// buffering the whole stem and per-depth key matrix before returning, it
+// emits a stem notification and then one notification per completed depth
+// level as the traversal advances, followed by a terminal message with the
+// aggregated metrics. The traversal runs off the RPC goroutine. Memory is
+// not bounded per level: the walk for level d materializes the keys of
+// every level up to d, so the last walk holds the whole key matrix.
+//
+// Parameters
+// - path 		path from root where the slice starts
+// - depth		depth to walk from the slice head
+// - stateRoot	state root of the slice
+// - opts		which extra data (node blobs, decoded leaves) to include per level
+func (api *PublicDebugAPI) SubscribeSlice(ctx context.Context, path string, depth int, stateRoot string, opts SliceSubscriptionOptions) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	stateRootByte, err := hexutil.Decode(stateRoot)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect input, expected string representation of hex for root")
+	}
+	slicePath := pathStringToKeyBytes(path)
+	if slicePath == nil {
+		return nil, fmt.Errorf("incorrect input, expected string representation of hex for path")
+	}
+
+	// make sure root is actually safe to load before we try, exactly like
+	// GetSliceKeys/GetSlice do; there is no snapshot-backed equivalent of a
+	// subscription, so a pruned/non-canonical root is always an error here
+	root := common.BytesToHash(stateRootByte)
+	useSnapshot, err := api.resolveStateRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	if useSnapshot {
+		return nil, fmt.Errorf("state root %s has no trie left to read nodes from; it is only servable from the snapshot layer, which has no trie nodes (try GetSliceKeys instead)", root.Hex())
+	}
+	tr, err := api.eth.BlockChain().GetSecureTrie(root)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the trie %v", err)
+	}
+
+	sliceID := fmt.Sprintf("%s-%02d-%s", path, depth, stateRoot[2:8])
+	rpcSub := notifier.CreateSubscription()
+
+	// the producer runs in its own goroutine so large or deep traversals
+	// never block the RPC goroutine; it exits as soon as the traversal
+	// finishes or the subscription/context is torn down
+	go func() {
+		api.sliceSubscriptionLoop(ctx, notifier, rpcSub, tr, slicePath, depth, sliceID, opts)
+	}()
+
+	return rpcSub, nil
+}
+
+// sliceSubscriptionLoop walks the slice iterator one depth level at a time,
+// pushing a notification per level into notifier and stopping cleanly once
+// the traversal finishes, the subscription is unsubscribed, or ctx is done.
+func (api *PublicDebugAPI) sliceSubscriptionLoop(ctx context.Context, notifier *rpc.Notifier, rpcSub *rpc.Subscription, tr *trie.SecureTrie, slicePath []byte, depth int, sliceID string, opts SliceSubscriptionOptions) {
+	metrics := GetSliceResponseMetrics{
+		Counts: make(map[string]int),
+		Time:   make(map[string]string),
+	}
+	start := time.Now().UnixNano()
+
+	// fetch the stem exactly like GetSliceKeys/GetSlice do, on a
+	// freshly-created iterator
+	it := tr.NewSliceIterator(slicePath)
+	it.Next(true)
+	stemKeys := it.StemKeys()
+	metrics.Counts["00 stem-nodes"] = len(stemKeys)
+
+	stemMsg := SliceNotification{SliceID: sliceID, Depth: -1, Keys: make([]string, 0, len(stemKeys))}
+	if opts.IncludeNodes {
+		stemMsg.Nodes = make(map[string]string)
+	}
+	for _, key := range stemKeys {
+		keyStr := fmt.Sprintf("%x", key)
+		stemMsg.Keys = append(stemMsg.Keys, keyStr)
+		if opts.IncludeNodes {
+			if blob, _, ok := api.resolveTrieNode(key); ok {
+				stemMsg.Nodes[keyStr] = blob
+			}
+		}
+	}
+	if !api.notifySlice(notifier, rpcSub, stemMsg) {
+		return
+	}
+
+	// walk the slice one depth level at a time: each level re-runs Slice on
+	// a fresh iterator bounded to that level only. This redoes the upper
+	// levels' traversal work on every iteration, but in exchange the
+	// traversal can actually be interrupted between levels (the single
+	// Slice(depth, false) call GetSlice uses blocks for the whole depth in
+	// one shot, so ctx/rpcSub/notifier could only ever be checked after
+	// everything was already materialized). Each Slice(d, false) call still
+	// returns the keys of all levels up to d, of which only level d is sent.
+	var leaves []trie.Leaf
+	maxDepth := 0
+	for d := 1; d <= depth; d++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rpcSub.Err():
+			return
+		case <-notifier.Closed():
+			return
+		default:
+		}
+
+		levelIt := tr.NewSliceIterator(slicePath)
+		stateKeys, levelLeaves := levelIt.Slice(d, false)
+		leaves = levelLeaves
+
+		depthLevel := stateKeys[d-1]
+		if len(depthLevel) == 0 {
+			break
+		}
+		maxDepth = d
+
+		msg := SliceNotification{SliceID: sliceID, Depth: d - 1, Keys: make([]string, 0, len(depthLevel))}
+		if opts.IncludeNodes {
+			msg.Nodes = make(map[string]string)
+		}
+		for _, key := range depthLevel {
+			keyStr := fmt.Sprintf("%x", key)
+			msg.Keys = append(msg.Keys, keyStr)
+			if opts.IncludeNodes {
+				if blob, _, ok := api.resolveTrieNode(key); ok {
+					msg.Nodes[keyStr] = blob
+				}
+			}
+		}
+		if !api.notifySlice(notifier, rpcSub, msg) {
+			return
+		}
+	}
+	metrics.Counts["01 max-depth"] = maxDepth
+	metrics.Counts["03 leaves"] = len(leaves)
+
+	// decoded leaves, if requested, ride along on the terminal message:
+	// the underlying Slice call doesn't report leaves per depth level, so
+	// there is no honest way to stream them incrementally
+	var decodedLeaves map[string]LeafData
+	if opts.IncludeLeaves {
+		decodedLeaves = make(map[string]LeafData, len(leaves))
+		for _, leaf := range leaves {
+			var account types.StateAccount
+			if err := rlp.DecodeBytes(leaf.Value, &account); err != nil {
+				continue
+			}
+			decodedLeaves[fmt.Sprintf("%x", leaf.Key)] = LeafData{
+				Nonce:    account.Nonce,
+				Balance:  account.Balance.String(),
+				Root:     account.Root.Hex(),
+				CodeHash: hexutil.Encode(account.CodeHash),
+			}
+		}
+	}
+
+	metrics.Time["00 total"] = timeDiffToMiliseconds(time.Now().UnixNano() - start)
+	api.notifySlice(notifier, rpcSub, SliceNotification{SliceID: sliceID, Done: true, Leaves: decodedLeaves, Metrics: &metrics})
+}
+
+// notifySlice pushes a single notification to the subscriber, reporting
+// whether the subscription is still alive.
+func (api *PublicDebugAPI) notifySlice(notifier *rpc.Notifier, rpcSub *rpc.Subscription, msg SliceNotification) bool {
+	return notifier.Notify(rpcSub.ID, msg) == nil
+}
+
+// resolveStateRoot checks whether root is safe to load a trie for. It
+// reports useSnapshot=true when the MPT for root is gone but the snapshot
+// layer can still service the slice, or a *RootResolutionError when neither
+// can.
+func (api *PublicDebugAPI) resolveStateRoot(root common.Hash) (useSnapshot bool, err error) {
+	bc := api.eth.BlockChain()
+
+	current := bc.CurrentHeader()
+	if current == nil {
+		return false, &RootResolutionError{Kind: ErrRootUnknown}
+	}
+
+	// walk back through the window of tries kept in memory looking for a
+	// canonical header with this root
+	isCanonical := false
+	for header := current; header != nil; header = bc.GetHeaderByHash(header.ParentHash) {
+		if header.Root == root {
+			isCanonical = true
+			break
+		}
+		if current.Number.Uint64()-header.Number.Uint64() >= uint64(core.TriesInMemory) {
+			break
+		}
+	}
+
+	if isCanonical && bc.HasState(root) {
+		return false, nil
+	}
+
+	// the MPT is unavailable (or the root was never canonical); the
+	// snapshot layer may still be able to service the slice
+	if snaps := bc.Snapshots(); snaps != nil && snaps.Snapshot(root) != nil {
+		return true, nil
+	}
+
+	if !isCanonical {
+		return false, &RootResolutionError{Kind: ErrRootNonCanonical, ClosestRoot: current.Root}
+	}
+	return false, &RootResolutionError{Kind: ErrRootPruned, ClosestRoot: current.Root}
+}
+
+// getSliceKeysFromSnapshot fills in response by walking the snapshot
+// layer's flat account iterator instead of the MPT. The snapshot has no
+// internal trie nodes, so there is no stem to report and the whole matching
+// range is returned as a single depth level, regardless of the requested
+// depth.
+func (api *PublicDebugAPI) getSliceKeysFromSnapshot(response GetSliceKeysResponse, root common.Hash, path string, slicePath []byte, depth int) (GetSliceKeysResponse, error) {
+	timerStart := time.Now().UnixNano()
+
+	snap := api.eth.BlockChain().Snapshots().Snapshot(root)
+	it, err := snap.AccountIterator(seekHashForPath(path))
+	if err != nil {
+		return GetSliceKeysResponse{}, fmt.Errorf("error opening snapshot account iterator %v", err)
+	}
+	defer it.Release()
+
+	keys := make([]string, 0)
+	for it.Next() {
+		hash := it.Hash()
+		keyStr := fmt.Sprintf("%x", hash[:])
+		if len(keyStr) < len(path) || keyStr[:len(path)] != path {
+			break
+		}
+		keys = append(keys, keyStr)
+	}
+	if err := it.Error(); err != nil {
+		return GetSliceKeysResponse{}, fmt.Errorf("error walking snapshot account iterator %v", err)
+	}
+	if len(keys) > 0 {
+		response.State = append(response.State, keys)
+	}
+	response.Metrics.Time["02 fetch-slice-keys"] = timeDiffToMiliseconds(time.Now().UnixNano() - timerStart)
+
+	return response, nil
+}
+
+// trieDB returns the trie node database backing the chain's state cache, so
+// that node blobs can be resolved by hash for the slicing and node-lookup
+// APIs below.
+func (api *PublicDebugAPI) trieDB() *trie.Database {
+	return api.eth.BlockChain().StateCache().TrieDB()
+}
+
+// resolveTrieNode fetches the RLP-encoded blob for a single trie node key.
+// It prefers the trie node cache, falling back to the raw KV store, and
+// reports whether the node was found at all and whether the cache served it.
+// GetSlice, SubscribeSlice and GetTrieNodes all resolve nodes through this
+// one method so they can't diverge on what counts as "found".
+func (api *PublicDebugAPI) resolveTrieNode(key []byte) (blob string, cached bool, found bool) {
+	hash := common.BytesToHash(key)
+	if raw, err := api.trieDB().Node(hash); err == nil && len(raw) > 0 {
+		return hexutil.Encode(raw), true, true
+	}
+	raw, err := api.eth.ChainDb().Get(hash.Bytes())
+	if err != nil || len(raw) == 0 {
+		return "", false, false
+	}
+	return hexutil.Encode(raw), false, true
+}
+
+// maxTrieNodesPerCall bounds the number of hashes a single GetTrieNodes call
+// may resolve, so a caller can't force the node to hold an unbounded number
+// of node blobs in memory at once. 1024 is only the default; Go code can
+// override it via SetMaxTrieNodesPerCall. No command-line flag or config
+// option sets it.
+var maxTrieNodesPerCall = 1024
+
+// SetMaxTrieNodesPerCall overrides the default per-call cap enforced by
+// GetTrieNodes. Call it once during node setup, before any RPC traffic
+// arrives.
+func SetMaxTrieNodesPerCall(max int) {
+	maxTrieNodesPerCall = max
+}
+
+// GetTrieNodesResponse is the result of resolving a batch of trie node
+// hashes to their raw, RLP-encoded blobs.
+type GetTrieNodesResponse struct {
+	Nodes   map[string]string           `json:"nodes"`  // hash -> RLP-encoded node blob
+	Errors  map[string]string           `json:"errors"` // hash -> reason it could not be resolved
+	Metrics GetTrieNodesResponseMetrics `json:"metrics"`
+}
+
+type GetTrieNodesResponseMetrics struct {
+	CacheHits   int `json:"cacheHits"`
+	CacheMisses int `json:"cacheMisses"`
+}
+
+// GetTrieNodes resolves a batch of trie node hashes to their raw node blobs,
+// sharing the same resolver GetSlice uses. Nodes that are missing or pruned
+// are reported per-hash in Errors rather than aborting the whole call.
+//
+// Parameters
+// - hashes		the trie node hashes to resolve, capped at maxTrieNodesPerCall
+func (api *PublicDebugAPI) GetTrieNodes(ctx context.Context, hashes []common.Hash) (GetTrieNodesResponse, error) {
+	if len(hashes) > maxTrieNodesPerCall {
+		return GetTrieNodesResponse{}, fmt.Errorf("too many hashes requested: %d (max %d)", len(hashes), maxTrieNodesPerCall)
+	}
+
+	response := GetTrieNodesResponse{
+		Nodes:  make(map[string]string),
+		Errors: make(map[string]string),
+	}
+
+	for _, hash := range hashes {
+		hashStr := hash.Hex()
+
+		blob, cached, ok := api.resolveTrieNode(hash[:])
+		if !ok {
+			response.Metrics.CacheMisses++
+			response.Errors[hashStr] = "node not found or pruned"
+			continue
+		}
+		if cached {
+			response.Metrics.CacheHits++
+		} else {
+			response.Metrics.CacheMisses++
+		}
+		response.Nodes[hashStr] = blob
+	}
+
+	return response, nil
+}
+
+// seekHashForPath builds the hash getSliceKeysFromSnapshot seeks the account
+// iterator to for a given path prefix. path is a packed hex string (unlike
+// the nibble-per-byte slicePath the trie iterators use), so it's right-padded
+// with zeros out to a full 32-byte hash instead of being passed through
+// common.BytesToHash, which would zero-pad on the left and push the
+// meaningful nibbles to the wrong end of the hash. Callers must already have
+// validated len(path) <= 64.
+func seekHashForPath(path string) common.Hash {
+	return common.HexToHash(path + strings.Repeat("0", 64-len(path)))
+}
+
+// isEOAAccount reports whether an account leaf with the given code hash and
+// storage root belongs to an externally-owned account rather than a
+// contract: true when both are still at their empty defaults.
+func isEOAAccount(codeHash, storageRoot common.Hash) bool {
+	return codeHash == types.EmptyCodeHash && storageRoot == types.EmptyRootHash
+}
+
 func pathStringToKeyBytes(input string) []byte {
 	if input == "" {
 		return nil
@@ -138,12 +863,6 @@ func timeDiffToMiliseconds(input int64) string {
 	return fmt.Sprintf("%.6f", float64(input)/(1000*1000))
 }
 
-///////////////////////
-//
-// We will mutate this later for getTrieNodes([Hash])
-//
-///////////////////////
-
 // GetLevelDbKey retrieves the value of a key from levelDB backend
 func (api *PublicDebugAPI) GetLevelDbKey(ctx context.Context, input string) (string, error) {
 	ldb, ok := api.eth.ChainDb().(interface {
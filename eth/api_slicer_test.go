@@ -0,0 +1,207 @@
+package eth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+func TestPathStringToKeyBytes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []byte
+	}{
+		{"", nil},
+		{"a1", []byte{0xa, 0x1}},
+		{"0123456789abcdef", []byte{0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x9, 0xa, 0xb, 0xc, 0xd, 0xe, 0xf}},
+		{"g1", nil},
+		{"A1", nil},
+	}
+	for _, tt := range tests {
+		got := pathStringToKeyBytes(tt.input)
+		if len(got) != len(tt.want) {
+			t.Errorf("pathStringToKeyBytes(%q) = %v, want %v", tt.input, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("pathStringToKeyBytes(%q) = %v, want %v", tt.input, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestTimeDiffToMiliseconds(t *testing.T) {
+	got := timeDiffToMiliseconds(1500000)
+	want := "1.500000"
+	if got != want {
+		t.Errorf("timeDiffToMiliseconds(1500000) = %q, want %q", got, want)
+	}
+}
+
+func TestRootResolutionErrorUnwrap(t *testing.T) {
+	err := &RootResolutionError{Kind: ErrRootPruned}
+	if !errors.Is(err, ErrRootPruned) {
+		t.Errorf("errors.Is(err, ErrRootPruned) = false, want true")
+	}
+	if got := err.Error(); got != ErrRootPruned.Error() {
+		t.Errorf("Error() = %q, want %q", got, ErrRootPruned.Error())
+	}
+
+	closest := common.HexToHash("0x1234")
+	withRoot := &RootResolutionError{Kind: ErrRootNonCanonical, ClosestRoot: closest}
+	if withRoot.Error() == ErrRootNonCanonical.Error() {
+		t.Errorf("Error() should include the closest root when set")
+	}
+}
+
+// TestStorageTrieIsSecureTrie confirms the assumption GetStorageSliceKeys'
+// type assertion relies on: StateDB.StorageTrie (backed by the real
+// cachingDB.OpenStorageTrie implementation) hands back a *trie.SecureTrie
+// under the generic state.Trie interface for an account with storage set.
+func TestStorageTrieIsSecureTrie(t *testing.T) {
+	db := state.NewDatabase(rawdb.NewMemoryDatabase())
+	statedb, err := state.New(common.Hash{}, db, nil)
+	if err != nil {
+		t.Fatalf("state.New failed: %v", err)
+	}
+
+	addr := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+	statedb.CreateAccount(addr)
+	statedb.SetState(addr, common.HexToHash("0x1"), common.HexToHash("0x2"))
+	if _, err := statedb.Commit(false); err != nil {
+		t.Fatalf("statedb.Commit failed: %v", err)
+	}
+
+	storageTrie, err := statedb.StorageTrie(addr)
+	if err != nil {
+		t.Fatalf("StorageTrie failed: %v", err)
+	}
+	if storageTrie == nil {
+		t.Fatal("expected a non-nil storage trie for an account with storage set")
+	}
+	if _, ok := storageTrie.(*trie.SecureTrie); !ok {
+		t.Fatalf("StorageTrie returned %T, want *trie.SecureTrie", storageTrie)
+	}
+}
+
+func TestGetTrieNodesRejectsOversizedBatch(t *testing.T) {
+	api := &PublicDebugAPI{}
+	hashes := make([]common.Hash, maxTrieNodesPerCall+1)
+	_, err := api.GetTrieNodes(context.Background(), hashes)
+	if err == nil {
+		t.Fatal("expected an error for a batch exceeding maxTrieNodesPerCall, got nil")
+	}
+}
+
+func TestIsEOAAccount(t *testing.T) {
+	if !isEOAAccount(types.EmptyCodeHash, types.EmptyRootHash) {
+		t.Error("an account with an empty code hash and empty storage root should be an EOA")
+	}
+	if isEOAAccount(common.HexToHash("0x1234"), types.EmptyRootHash) {
+		t.Error("a non-empty code hash should never be classified as an EOA")
+	}
+	if isEOAAccount(types.EmptyCodeHash, common.HexToHash("0x1234")) {
+		t.Error("a non-empty storage root should never be classified as an EOA")
+	}
+}
+
+// TestSeekHashForPath guards the bug fixed for the chunk0-5 snapshot
+// fallback: the seek hash must be built from the packed path string, with
+// the meaningful nibbles at the *high* end of the hash, not from right-
+// aligning the nibble-expanded slicePath bytes (which would put them at the
+// low end instead).
+func TestSeekHashForPath(t *testing.T) {
+	got := seekHashForPath("a1")
+	want := common.HexToHash("0xa100000000000000000000000000000000000000000000000000000000000000")
+	if got != want {
+		t.Errorf("seekHashForPath(%q) = %s, want %s", "a1", got.Hex(), want.Hex())
+	}
+
+	full := "1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+	if got := seekHashForPath(full); got != common.HexToHash("0x"+full) {
+		t.Errorf("seekHashForPath of a full-length path should round-trip unchanged, got %s", got.Hex())
+	}
+}
+
+// TestSliceIteratorPipeline exercises the NewSliceIterator/StemKeys/Slice
+// pipeline GetSliceKeys, GetSlice and GetStorageSliceKeys all share, against
+// a real *trie.SecureTrie, confirming that a slice rooted at a given path
+// has a non-empty stem and uncovers at least one node below it.
+func TestSliceIteratorPipeline(t *testing.T) {
+	triedb := trie.NewDatabase(rawdb.NewMemoryDatabase())
+	tr, err := trie.NewSecure(common.Hash{}, triedb)
+	if err != nil {
+		t.Fatalf("trie.NewSecure failed: %v", err)
+	}
+
+	keys := [][]byte{
+		common.HexToHash("0xa000000000000000000000000000000000000000000000000000000000000001").Bytes(),
+		common.HexToHash("0xa100000000000000000000000000000000000000000000000000000000000002").Bytes(),
+		common.HexToHash("0xb000000000000000000000000000000000000000000000000000000000000003").Bytes(),
+	}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, []byte{byte(i + 1)}); err != nil {
+			t.Fatalf("TryUpdate failed: %v", err)
+		}
+	}
+
+	slicePath := pathStringToKeyBytes("a")
+	it := tr.NewSliceIterator(slicePath)
+	it.Next(true)
+	if len(it.StemKeys()) == 0 {
+		t.Fatal("expected at least one stem node above the \"a\" prefix")
+	}
+
+	levels, _ := tr.NewSliceIterator(slicePath).Slice(8, false)
+	var found int
+	for _, level := range levels {
+		found += len(level)
+	}
+	if found == 0 {
+		t.Fatal("expected the slice to uncover at least one node under the \"a\" prefix")
+	}
+}
+
+// TestPerLevelSliceMatchesFullSlice confirms the chunk0-4 rewrite of
+// sliceSubscriptionLoop's per-level walk (repeated Slice(d, false) calls on
+// fresh iterators) agrees with the single Slice(depth, false) call GetSlice
+// uses, i.e. streaming one level at a time didn't change what's returned.
+func TestPerLevelSliceMatchesFullSlice(t *testing.T) {
+	triedb := trie.NewDatabase(rawdb.NewMemoryDatabase())
+	tr, err := trie.NewSecure(common.Hash{}, triedb)
+	if err != nil {
+		t.Fatalf("trie.NewSecure failed: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		key := common.LeftPadBytes([]byte{byte(i)}, 32)
+		if err := tr.TryUpdate(key, []byte{byte(i + 1)}); err != nil {
+			t.Fatalf("TryUpdate failed: %v", err)
+		}
+	}
+
+	const depth = 3
+	slicePath := pathStringToKeyBytes("0")
+	full, _ := tr.NewSliceIterator(slicePath).Slice(depth, false)
+
+	for d := 1; d <= depth; d++ {
+		level, _ := tr.NewSliceIterator(slicePath).Slice(d, false)
+		want, got := full[d-1], level[d-1]
+		if len(got) != len(want) {
+			t.Fatalf("depth %d: got %d keys, want %d", d, len(got), len(want))
+		}
+		for i := range want {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Fatalf("depth %d key %d: got %x, want %x", d, i, got[i], want[i])
+			}
+		}
+	}
+}